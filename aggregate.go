@@ -6,8 +6,6 @@ import (
 	"log"
 	"strings"
 	"time"
-
-	"github.com/JustinAzoff/flow-indexer/backend"
 )
 
 var MAX_SANE_VALUE_LEN = 1000
@@ -218,47 +216,29 @@ func (d *DNSAggregator) Merge(other *DNSAggregator) {
 	return
 }
 
-func aggregate(aggregator *DNSAggregator, fn string) error {
-	f, err := backend.OpenDecompress(fn)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	br, err := NewBroReader(f)
+// aggregate reads fn through a RecordSource for format (auto-detected
+// from fn's extension when format is "") and feeds every record into
+// aggregator.
+func aggregate(aggregator *DNSAggregator, fn string, format string) error {
+	src, err := NewRecordSource(fn, format)
 	if err != nil {
 		return err
 	}
+	defer src.Close()
 
 	for {
-		rec, err := br.Next()
+		rec, err := src.Next()
+		if err == ErrSkipRecord {
+			aggregator.SkipRecord()
+			continue
+		}
 		if err != nil {
 			return err
 		}
 		if rec == nil {
 			break
 		}
-		ts := rec.GetFloat("ts")
-		query := rec.GetString("query")
-		qtype_name := rec.GetString("qtype_name")
-		answers := rec.GetStringList("answers")
-		ttls := rec.GetStringList("TTLs")
-		if rec.Error() != nil {
-			if rec.IsMissingFieldError() {
-				log.Printf("Skipping record with missing fields: %s", rec)
-				aggregator.SkipRecord()
-				continue
-			} else {
-				return rec.Error()
-			}
-		}
-		dns_record := DNSRecord{
-			ts:      ts,
-			query:   query,
-			qtype:   qtype_name,
-			answers: answers,
-			ttls:    ttls,
-		}
-		aggregator.AddRecord(dns_record)
+		aggregator.AddRecord(*rec)
 	}
 
 	return nil
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Config is the single JSON file the retention and stream subcommands
+// load their settings from (via -config): which database to store into,
+// plus whichever of retention/source/subscribers each of them uses. The
+// aggregate subcommand reads no config file.
+type Config struct {
+	DBURI          string                  `json:"db_uri"`
+	DBLegacyUpsert bool                    `json:"db_legacy_upsert"` // PGStore only; see PGStore.LegacyUpsert
+	Retention      []RetentionPolicyConfig `json:"retention"`
+	Source         StreamSourceConfig      `json:"source"`
+	Subscribers    []SubscriberConfig      `json:"subscribers"`
+}
+
+// StreamSourceConfig is the config-file shape of an Ingestor, used by
+// the stream subcommand. Kind selects which Ingestor newIngestorFromConfig
+// builds; the other fields are interpreted according to Kind and left
+// zero otherwise.
+type StreamSourceConfig struct {
+	Kind string `json:"kind"` // "kafka", "tcp", "udp", or "file"
+
+	// kafka
+	Brokers []string `json:"brokers"`
+	GroupID string   `json:"group_id"`
+	Topics  []string `json:"topics"`
+
+	// tcp, udp
+	Addr string `json:"addr"`
+
+	// file
+	Path      string `json:"path"`
+	PollEvery string `json:"poll_every"` // duration string, e.g. "1s"
+}
+
+// SubscriberConfig is the config-file shape of a Subscriber, used by the
+// stream subcommand. Kind selects which Subscriber buildSubscribers
+// builds; the other fields are interpreted according to Kind and left
+// zero otherwise.
+type SubscriberConfig struct {
+	Kind string `json:"kind"` // "webhook", "kafka", or "file"
+
+	// webhook
+	URL       string `json:"url"`
+	BatchSize int    `json:"batch_size"`
+
+	// kafka
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+
+	// file
+	Path string `json:"path"`
+}
+
+// RetentionPolicyConfig is the config-file shape of a RetentionPolicy.
+// MaxAge is a duration string (e.g. "4320h" for 180 days) since JSON has
+// no native duration type.
+type RetentionPolicyConfig struct {
+	Table    string `json:"table"`
+	MaxAge   string `json:"max_age"`
+	MinCount uint   `json:"min_count"`
+}
+
+// LoadConfig reads and parses the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg Config
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// OpenStore opens the Store named by uri's scheme: postgres(ql):// and
+// mysql:// select PGStore/MySQLStore, anything else is treated as a
+// SQLite file path. legacyUpsert is only meaningful for PGStore; it's
+// ignored for the other backends, which have no pre-9.5-style fallback.
+func OpenStore(uri string, legacyUpsert bool) (Store, error) {
+	switch {
+	case strings.HasPrefix(uri, "postgres://"), strings.HasPrefix(uri, "postgresql://"):
+		return NewPGStore(uri, legacyUpsert)
+	case strings.HasPrefix(uri, "mysql://"):
+		return NewMySQLStore(strings.TrimPrefix(uri, "mysql://"))
+	default:
+		return NewSQLiteStore(uri)
+	}
+}
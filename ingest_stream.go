@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// zeekDNSJSON mirrors the subset of Zeek's dns.log JSON fields that
+// aggregate() already reads off a BroReader: ts, query, qtype_name,
+// answers and TTLs.
+type zeekDNSJSON struct {
+	Ts        float64  `json:"ts"`
+	Query     string   `json:"query"`
+	QTypeName string   `json:"qtype_name"`
+	Answers   []string `json:"answers"`
+	TTLs      []string `json:"TTLs"`
+}
+
+func decodeZeekJSON(raw []byte) (*DNSRecord, error) {
+	var z zeekDNSJSON
+	if err := json.Unmarshal(raw, &z); err != nil {
+		return nil, err
+	}
+	return &DNSRecord{
+		ts:      z.Ts,
+		query:   z.Query,
+		qtype:   z.QTypeName,
+		answers: z.Answers,
+		ttls:    z.TTLs,
+	}, nil
+}
+
+// StreamRecord pairs a decoded DNSRecord with an optional ack callback.
+// The flusher only calls Ack once the batch containing this record has
+// been durably written by Store.Update, which is what makes Kafka
+// ingestion at-least-once instead of at-most-once.
+type StreamRecord struct {
+	Record DNSRecord
+	Ack    func()
+}
+
+// Ingestor feeds a continuous stream of DNS records to a StreamFlusher.
+// Implementations decide how records arrive; the flush/store path
+// downstream is shared.
+type Ingestor interface {
+	Run(out chan<- StreamRecord) error
+	Close() error
+}
+
+// StreamFlusher snapshots its live DNSAggregator on a timer or a record
+// count threshold and hands the snapshot to Store.Update, while a fresh,
+// empty aggregator takes over immediately. This double-buffering keeps
+// ingestion from blocking on a slow Update().
+type StreamFlusher struct {
+	Store        Store
+	FlushEvery   time.Duration
+	FlushRecords uint
+
+	mu         sync.Mutex
+	aggregator *DNSAggregator
+	pending    []func()
+}
+
+func NewStreamFlusher(store Store, flushEvery time.Duration, flushRecords uint) *StreamFlusher {
+	return &StreamFlusher{
+		Store:        store,
+		FlushEvery:   flushEvery,
+		FlushRecords: flushRecords,
+		aggregator:   NewDNSAggregator(),
+	}
+}
+
+// Add feeds a single record into the live aggregator, starting a Flush
+// on its own goroutine if FlushRecords is reached.
+func (f *StreamFlusher) Add(sr StreamRecord) {
+	f.mu.Lock()
+	f.aggregator.AddRecord(sr.Record)
+	if sr.Ack != nil {
+		f.pending = append(f.pending, sr.Ack)
+	}
+	ready := f.FlushRecords > 0 && f.aggregator.totalRecords >= f.FlushRecords
+	f.mu.Unlock()
+	if ready {
+		go f.Flush()
+	}
+}
+
+// Flush swaps in a fresh aggregator, stores the snapshot taken from the
+// old one, and only then calls the ack callbacks it covered.
+func (f *StreamFlusher) Flush() error {
+	f.mu.Lock()
+	agg := f.aggregator
+	acks := f.pending
+	f.aggregator = NewDNSAggregator()
+	f.pending = nil
+	f.mu.Unlock()
+
+	if agg.totalRecords == 0 {
+		return nil
+	}
+	result := agg.GetResult()
+	if _, err := f.Store.Update(result); err != nil {
+		log.Printf("stream: flush failed, records will be redelivered: %v", err)
+		return err
+	}
+	for _, ack := range acks {
+		ack()
+	}
+	return nil
+}
+
+// Run ticks Flush every FlushEvery until stop is closed, flushing once
+// more on the way out so nothing ingested since the last tick is lost.
+func (f *StreamFlusher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(f.FlushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.Flush()
+		case <-stop:
+			f.Flush()
+			return
+		}
+	}
+}
+
+// KafkaIngestor consumes Zeek dns.log JSON messages from a Kafka topic
+// using a consumer group, so several bro-pdns stream processes can share
+// partitions. Offsets are committed lazily by MarkOffset, only once the
+// StreamFlusher's ack fires for the batch containing that message.
+type KafkaIngestor struct {
+	Brokers []string
+	GroupID string
+	Topics  []string
+
+	group sarama.ConsumerGroup
+	out   chan<- StreamRecord
+}
+
+func NewKafkaIngestor(brokers []string, groupID string, topics []string) (*KafkaIngestor, error) {
+	cfg := sarama.NewConfig()
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaIngestor{Brokers: brokers, GroupID: groupID, Topics: topics, group: group}, nil
+}
+
+func (k *KafkaIngestor) Run(out chan<- StreamRecord) error {
+	k.out = out
+	ctx := context.Background()
+	for {
+		if err := k.group.Consume(ctx, k.Topics, k); err != nil {
+			return err
+		}
+	}
+}
+
+func (k *KafkaIngestor) Close() error {
+	return k.group.Close()
+}
+
+func (k *KafkaIngestor) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (k *KafkaIngestor) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim hands every message on claim to the flusher and only marks
+// its offset (sess.MarkOffset) once its batch has been durably stored. Kafka
+// commits the highest offset ever marked per partition, not a per-message
+// ledger, so marking offsets out of order would be unsafe: if an earlier
+// batch's Update failed (so its message is never marked) but a later
+// batch's Update succeeded and got marked, the next auto-commit would
+// advance the partition past the earlier, still-unacked message and it
+// would never be redelivered. acker tracks, per partition, the in-flight
+// offsets that haven't acked yet and only calls MarkOffset up through the
+// lowest one still outstanding, so a stuck batch blocks the commit point
+// for that partition without losing anything behind it.
+func (k *KafkaIngestor) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	acker := newPartitionAcker(sess)
+	for msg := range claim.Messages() {
+		rec, err := decodeZeekJSON(msg.Value)
+		if err != nil {
+			log.Printf("stream: skipping unparsable kafka message: %v", err)
+			continue
+		}
+		m := msg
+		acker.add(m)
+		k.out <- StreamRecord{
+			Record: *rec,
+			Ack:    func() { acker.ack(m) },
+		}
+	}
+	return nil
+}
+
+// partitionAcker commits Kafka offsets in order, per partition, even
+// though Ack callbacks fire in whatever order their overlapping flush
+// batches complete. It tracks every offset still in flight; once one
+// acks, it advances the partition's commit point past as long a
+// contiguous run of now-acked offsets as it can, stopping at the first
+// offset that's still outstanding.
+type partitionAcker struct {
+	sess sarama.ConsumerGroupSession
+
+	mu       sync.Mutex
+	inflight map[int32]map[int64]bool // partition -> offset -> acked?
+}
+
+func newPartitionAcker(sess sarama.ConsumerGroupSession) *partitionAcker {
+	return &partitionAcker{sess: sess, inflight: make(map[int32]map[int64]bool)}
+}
+
+// add records msg as in flight and not yet acked.
+func (a *partitionAcker) add(msg *sarama.ConsumerMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	offsets := a.inflight[msg.Partition]
+	if offsets == nil {
+		offsets = make(map[int64]bool)
+		a.inflight[msg.Partition] = offsets
+	}
+	offsets[msg.Offset] = false
+}
+
+// ack marks msg acked, then commits the longest contiguous run of acked
+// offsets starting at the lowest still-tracked offset for its partition,
+// so the commit point never advances past an offset that hasn't acked.
+func (a *partitionAcker) ack(msg *sarama.ConsumerMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	offsets := a.inflight[msg.Partition]
+	if offsets == nil {
+		return
+	}
+	offsets[msg.Offset] = true
+
+	lowest := msg.Offset
+	for o := range offsets {
+		if o < lowest {
+			lowest = o
+		}
+	}
+
+	commit := int64(-1)
+	for offsets[lowest] {
+		delete(offsets, lowest)
+		commit = lowest
+		lowest++
+	}
+	if commit >= 0 {
+		a.sess.MarkOffset(msg.Topic, msg.Partition, commit+1, "")
+	}
+}
+
+// LineListenerIngestor accepts newline-delimited Zeek dns.log JSON
+// records over a TCP or UDP socket, one line per record.
+type LineListenerIngestor struct {
+	Network string // "tcp" or "udp"
+	Addr    string
+
+	listener net.Listener
+	packet   net.PacketConn
+}
+
+func (l *LineListenerIngestor) Run(out chan<- StreamRecord) error {
+	switch l.Network {
+	case "tcp":
+		return l.runTCP(out)
+	case "udp":
+		return l.runUDP(out)
+	default:
+		return fmt.Errorf("stream: unknown network %q", l.Network)
+	}
+}
+
+func (l *LineListenerIngestor) runTCP(out chan<- StreamRecord) error {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return err
+	}
+	l.listener = ln
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go l.handleConn(conn, out)
+	}
+}
+
+func (l *LineListenerIngestor) handleConn(conn net.Conn, out chan<- StreamRecord) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		rec, err := decodeZeekJSON(scanner.Bytes())
+		if err != nil {
+			log.Printf("stream: skipping unparsable line from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		out <- StreamRecord{Record: *rec}
+	}
+}
+
+func (l *LineListenerIngestor) runUDP(out chan<- StreamRecord) error {
+	pc, err := net.ListenPacket("udp", l.Addr)
+	if err != nil {
+		return err
+	}
+	l.packet = pc
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		rec, err := decodeZeekJSON(buf[:n])
+		if err != nil {
+			log.Printf("stream: skipping unparsable datagram: %v", err)
+			continue
+		}
+		out <- StreamRecord{Record: *rec}
+	}
+}
+
+func (l *LineListenerIngestor) Close() error {
+	if l.listener != nil {
+		return l.listener.Close()
+	}
+	if l.packet != nil {
+		return l.packet.Close()
+	}
+	return nil
+}
+
+// FileTailIngestor tails a rotating Zeek dns.log the way `tail -F` does:
+// if the file shrinks out from under it, it reopens from the start.
+type FileTailIngestor struct {
+	Path      string
+	PollEvery time.Duration
+
+	stop chan struct{}
+}
+
+func (t *FileTailIngestor) Run(out chan<- StreamRecord) error {
+	t.stop = make(chan struct{})
+	if t.PollEvery == 0 {
+		t.PollEvery = time.Second
+	}
+
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		select {
+		case <-t.stop:
+			return nil
+		default:
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			offset += int64(len(line))
+			rec, derr := decodeZeekJSON(line)
+			if derr != nil {
+				log.Printf("stream: skipping unparsable line: %v", derr)
+			} else {
+				out <- StreamRecord{Record: *rec}
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		time.Sleep(t.PollEvery)
+		if info, statErr := os.Stat(t.Path); statErr == nil && info.Size() < offset {
+			f.Close()
+			if f, err = os.Open(t.Path); err != nil {
+				return err
+			}
+			offset = 0
+			reader = bufio.NewReader(f)
+		}
+	}
+}
+
+func (t *FileTailIngestor) Close() error {
+	close(t.stop)
+	return nil
+}
+
+// newIngestorFromConfig builds the Ingestor named by src.Kind, reading
+// whichever of src's fields that kind uses.
+func newIngestorFromConfig(src StreamSourceConfig) (Ingestor, error) {
+	switch src.Kind {
+	case "kafka":
+		return NewKafkaIngestor(src.Brokers, src.GroupID, src.Topics)
+	case "tcp":
+		return &LineListenerIngestor{Network: "tcp", Addr: src.Addr}, nil
+	case "udp":
+		return &LineListenerIngestor{Network: "udp", Addr: src.Addr}, nil
+	case "file":
+		pollEvery := time.Second
+		if src.PollEvery != "" {
+			d, err := time.ParseDuration(src.PollEvery)
+			if err != nil {
+				return nil, fmt.Errorf("stream: bad poll_every %q: %w", src.PollEvery, err)
+			}
+			pollEvery = d
+		}
+		return &FileTailIngestor{Path: src.Path, PollEvery: pollEvery}, nil
+	default:
+		return nil, fmt.Errorf("stream: unknown source kind %q", src.Kind)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeConsumerGroupSession implements sarama.ConsumerGroupSession,
+// recording every MarkOffset call so tests can assert on commit order
+// without a live Kafka broker.
+type fakeConsumerGroupSession struct {
+	marked []int64 // offsets passed to MarkOffset, in call order
+}
+
+func (f *fakeConsumerGroupSession) Claims() map[string][]int32 { return nil }
+func (f *fakeConsumerGroupSession) MemberID() string           { return "" }
+func (f *fakeConsumerGroupSession) GenerationID() int32        { return 0 }
+func (f *fakeConsumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	f.marked = append(f.marked, offset)
+}
+func (f *fakeConsumerGroupSession) Commit() {}
+func (f *fakeConsumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (f *fakeConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	f.marked = append(f.marked, msg.Offset)
+}
+func (f *fakeConsumerGroupSession) Context() context.Context { return context.Background() }
+
+func msg(partition int32, offset int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Topic: "dns", Partition: partition, Offset: offset}
+}
+
+func TestPartitionAckerCommitsContiguousRunsOnly(t *testing.T) {
+	sess := &fakeConsumerGroupSession{}
+	acker := newPartitionAcker(sess)
+
+	msgs := make([]*sarama.ConsumerMessage, 5)
+	for i := range msgs {
+		msgs[i] = msg(0, int64(i))
+		acker.add(msgs[i])
+	}
+
+	// Ack 2 and 3 first: nothing has committed yet, since 0 and 1 are
+	// still outstanding and the commit point can't skip over them.
+	acker.ack(msgs[2])
+	acker.ack(msgs[3])
+	if len(sess.marked) != 0 {
+		t.Fatalf("marked = %v after acking 2,3 with 0,1 outstanding; want no commits yet", sess.marked)
+	}
+
+	// Ack 0: it's the lowest outstanding offset, so the commit point
+	// safely advances past it alone, to offset 1 - it does not, and
+	// must not, skip ahead to cover the already-acked 2,3 since 1 is
+	// still an outstanding gap.
+	acker.ack(msgs[0])
+	if len(sess.marked) != 1 || sess.marked[0] != 1 {
+		t.Fatalf("marked = %v after acking 0 with 1 still outstanding; want a single commit of offset 1", sess.marked)
+	}
+
+	// Ack 1: now 1,2,3 are all acked contiguously, so the commit point
+	// advances to offset 4 (the next offset to consume).
+	acker.ack(msgs[1])
+	if len(sess.marked) != 2 || sess.marked[1] != 4 {
+		t.Fatalf("marked = %v, want a second commit of offset 4", sess.marked)
+	}
+
+	// Offset 4 never acks (its batch is still pending / failed), so no
+	// further commit happens even though every other offset is done.
+	if len(sess.marked) != 2 {
+		t.Fatalf("marked = %v, want exactly two commits with offset 4 still outstanding", sess.marked)
+	}
+}
+
+func TestPartitionAckerTracksPartitionsIndependently(t *testing.T) {
+	sess := &fakeConsumerGroupSession{}
+	acker := newPartitionAcker(sess)
+
+	p0 := msg(0, 10)
+	p1 := msg(1, 20)
+	acker.add(p0)
+	acker.add(p1)
+
+	// Acking partition 1's only outstanding offset must commit it even
+	// though partition 0's offset is still unacked.
+	acker.ack(p1)
+	if len(sess.marked) != 1 || sess.marked[0] != 21 {
+		t.Fatalf("marked = %v, want a single commit of offset 21 for partition 1", sess.marked)
+	}
+
+	acker.ack(p0)
+	if len(sess.marked) != 2 || sess.marked[1] != 11 {
+		t.Fatalf("marked = %v, want a second commit of offset 11 for partition 0", sess.marked)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "aggregate":
+		cmdAggregate(os.Args[2:])
+	case "retention":
+		cmdRetention(os.Args[2:])
+	case "stream":
+		cmdStream(os.Args[2:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bro-pdns <aggregate|retention|stream> [options]")
+}
+
+// cmdAggregate runs a one-shot aggregation over the given dns.log files
+// and prints the resulting totals; it doesn't store anything, it's the
+// same batch path aggregate() already provides, exposed as a CLI. With
+// -workers > 1, files are read concurrently through a ShardedAggregator
+// instead of the single-threaded path.
+func cmdAggregate(args []string) {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	format := fs.String("format", "", "input format: zeek, suricata-eve, dnstap (default: auto-detect per file)")
+	workers := fs.Int("workers", 1, "number of shards to aggregate across concurrently; 1 runs single-threaded")
+	fs.Parse(args)
+
+	fns := fs.Args()
+	if len(fns) == 0 {
+		log.Fatal("aggregate: at least one input file is required")
+	}
+
+	var result aggregationResult
+	if *workers > 1 {
+		merged, err := AggregateFilesSharded(fns, *format, *workers)
+		if err != nil {
+			log.Fatalf("aggregate: %v", err)
+		}
+		result = merged.GetResult()
+	} else {
+		aggregator := NewDNSAggregator()
+		for _, fn := range fns {
+			if err := aggregate(aggregator, fn, *format); err != nil {
+				log.Fatalf("aggregate: %s: %v", fn, err)
+			}
+		}
+		result = aggregator.GetResult()
+	}
+	log.Printf("records=%d skipped=%d tuples=%d individual=%d duration=%s",
+		result.TotalRecords, result.SkippedRecords, result.TuplesLen, result.IndividualLen, result.Duration)
+}
+
+// cmdRetention runs the retention policies from -config once, or, with
+// -interval set, keeps running them on that interval until interrupted.
+func cmdRetention(args []string) {
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to the JSON config file (db_uri + retention policies)")
+	interval := fs.Duration("interval", 0, "run retention on this interval instead of once and exiting")
+	fs.Parse(args)
+
+	if *configPath == "" {
+		log.Fatal("retention: -config is required")
+	}
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("retention: %v", err)
+	}
+	store, err := OpenStore(cfg.DBURI, cfg.DBLegacyUpsert)
+	if err != nil {
+		log.Fatalf("retention: %v", err)
+	}
+	defer store.Close()
+
+	if *interval <= 0 {
+		runRetentionOnce(store, cfg.Retention)
+		return
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go RunRetentionLoop(store, cfg.Retention, *interval, stop)
+	<-sig
+	close(stop)
+}
+
+// cmdStream runs the long-lived "bro-pdns stream" process: it builds the
+// Ingestor named by -config's source, feeds it into a StreamFlusher that
+// periodically stores what it's accumulated, and, if the config carries
+// retention policies, runs RunRetentionLoop alongside it so expiry keeps
+// up with ingestion instead of requiring a separate cron job.
+func cmdStream(args []string) {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to the JSON config file (db_uri, source, retention policies)")
+	flushEvery := fs.Duration("flush-every", 10*time.Second, "how often to store accumulated records")
+	flushRecords := fs.Uint("flush-records", 0, "store early once this many records have accumulated; 0 disables")
+	retentionEvery := fs.Duration("retention-every", time.Hour, "how often to run retention policies; 0 disables")
+	fs.Parse(args)
+
+	if *configPath == "" {
+		log.Fatal("stream: -config is required")
+	}
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("stream: %v", err)
+	}
+	store, err := OpenStore(cfg.DBURI, cfg.DBLegacyUpsert)
+	if err != nil {
+		log.Fatalf("stream: %v", err)
+	}
+	defer store.Close()
+
+	if len(cfg.Subscribers) > 0 {
+		setter, ok := store.(SubscriberSetter)
+		if !ok {
+			log.Fatalf("stream: %T does not support subscribers", store)
+		}
+		subs, err := buildSubscribers(cfg.Subscribers)
+		if err != nil {
+			log.Fatalf("stream: %v", err)
+		}
+		hub := NewSubscriberHub(subscriberHubBufferSize, subs...)
+		defer hub.Close()
+		setter.SetSubscribers(hub)
+	}
+
+	ingestor, err := newIngestorFromConfig(cfg.Source)
+	if err != nil {
+		log.Fatalf("stream: %v", err)
+	}
+	defer ingestor.Close()
+
+	flusher := NewStreamFlusher(store, *flushEvery, *flushRecords)
+	flushStop := make(chan struct{})
+	go flusher.Run(flushStop)
+
+	retentionStop := make(chan struct{})
+	if *retentionEvery > 0 && len(cfg.Retention) > 0 {
+		go RunRetentionLoop(store, cfg.Retention, *retentionEvery, retentionStop)
+	}
+
+	records := make(chan StreamRecord, 1024)
+	go func() {
+		if err := ingestor.Run(records); err != nil {
+			log.Fatalf("stream: ingestor stopped: %v", err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case rec := <-records:
+			flusher.Add(rec)
+		case <-sig:
+			close(retentionStop)
+			close(flushStop)
+			return
+		}
+	}
+}
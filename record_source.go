@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+
+	"github.com/JustinAzoff/flow-indexer/backend"
+)
+
+// ErrSkipRecord is returned by RecordSource.Next to mean "this input
+// record was malformed, count it as skipped and keep reading" as
+// opposed to a real error, which aborts the run.
+var ErrSkipRecord = errors.New("record_source: skip malformed record")
+
+// RecordSource produces DNSRecords one at a time from some underlying
+// sensor log format. A nil record with a nil error means the source is
+// exhausted. This lets aggregate() stay the same regardless of whether
+// the bytes on disk came from Zeek, Suricata or dnstap.
+type RecordSource interface {
+	Next() (*DNSRecord, error)
+	Close() error
+}
+
+// NewRecordSource opens fn and returns a RecordSource for format. An
+// empty format is auto-detected from fn's extension.
+func NewRecordSource(fn string, format string) (RecordSource, error) {
+	if format == "" {
+		format = detectFormat(fn)
+	}
+	switch format {
+	case "zeek":
+		return NewZeekRecordSource(fn)
+	case "suricata-eve":
+		return NewSuricataEveRecordSource(fn)
+	case "dnstap":
+		return NewDnstapRecordSource(fn)
+	default:
+		return nil, fmt.Errorf("record_source: unknown format %q", format)
+	}
+}
+
+func detectFormat(fn string) string {
+	base := strings.TrimSuffix(fn, ".gz")
+	switch {
+	case strings.HasSuffix(base, ".eve.json"):
+		return "suricata-eve"
+	case strings.HasSuffix(base, ".dnstap"), strings.HasPrefix(fn, "unix:"):
+		return "dnstap"
+	default:
+		return "zeek"
+	}
+}
+
+// ZeekRecordSource reads a Zeek dns.log (any of the extensions
+// backend.OpenDecompress understands) through the existing BroReader.
+type ZeekRecordSource struct {
+	f  io.ReadCloser
+	br *BroReader
+}
+
+func NewZeekRecordSource(fn string) (RecordSource, error) {
+	f, err := backend.OpenDecompress(fn)
+	if err != nil {
+		return nil, err
+	}
+	br, err := NewBroReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ZeekRecordSource{f: f, br: br}, nil
+}
+
+func (z *ZeekRecordSource) Next() (*DNSRecord, error) {
+	rec, err := z.br.Next()
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, nil
+	}
+	ts := rec.GetFloat("ts")
+	query := rec.GetString("query")
+	qtype_name := rec.GetString("qtype_name")
+	answers := rec.GetStringList("answers")
+	ttls := rec.GetStringList("TTLs")
+	if rec.Error() != nil {
+		if rec.IsMissingFieldError() {
+			return nil, ErrSkipRecord
+		}
+		return nil, rec.Error()
+	}
+	return &DNSRecord{
+		ts:      ts,
+		query:   query,
+		qtype:   qtype_name,
+		answers: answers,
+		ttls:    ttls,
+	}, nil
+}
+
+func (z *ZeekRecordSource) Close() error {
+	return z.f.Close()
+}
+
+// suricataEveLine is the subset of a Suricata EVE JSON "dns" event this
+// reader cares about.
+type suricataEveLine struct {
+	EventType string `json:"event_type"`
+	Timestamp string `json:"timestamp"`
+	DNS       struct {
+		Rrname  string `json:"rrname"`
+		Rrtype  string `json:"rrtype"`
+		Answers []struct {
+			Rdata string      `json:"rdata"`
+			TTL   json.Number `json:"ttl"`
+		} `json:"answers"`
+	} `json:"dns"`
+}
+
+// suricataEveTimeLayout matches Suricata's default EVE JSON "timestamp"
+// field, e.g. "2017-05-24T16:14:07.183971+0000" — the UTC offset has no
+// colon, so it doesn't parse as time.RFC3339Nano.
+const suricataEveTimeLayout = "2006-01-02T15:04:05.999999-0700"
+
+// SuricataEveRecordSource reads newline-delimited Suricata EVE JSON,
+// picking out event_type=="dns" lines and mapping dns.rrname/rrtype and
+// each dns.answers[].rdata/ttl onto a DNSRecord the same shape aggregate()
+// already produces for Zeek.
+type SuricataEveRecordSource struct {
+	f       io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+func NewSuricataEveRecordSource(fn string) (RecordSource, error) {
+	f, err := backend.OpenDecompress(fn)
+	if err != nil {
+		return nil, err
+	}
+	return &SuricataEveRecordSource{f: f, scanner: bufio.NewScanner(f)}, nil
+}
+
+func (s *SuricataEveRecordSource) Next() (*DNSRecord, error) {
+	for s.scanner.Scan() {
+		rec, err := parseSuricataEveLine(s.scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			continue
+		}
+		return rec, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// parseSuricataEveLine maps one line of Suricata EVE JSON onto a
+// DNSRecord. It returns (nil, nil) for a line that isn't a dns event (or
+// has no rrname) rather than an error, since that's not malformed input,
+// just not interesting; a genuinely malformed line or an unparsable
+// timestamp returns ErrSkipRecord.
+func parseSuricataEveLine(line []byte) (*DNSRecord, error) {
+	var ev suricataEveLine
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, ErrSkipRecord
+	}
+	if ev.EventType != "dns" || ev.DNS.Rrname == "" {
+		return nil, nil
+	}
+	ts, err := time.Parse(suricataEveTimeLayout, ev.Timestamp)
+	if err != nil {
+		return nil, ErrSkipRecord
+	}
+	var answers, ttls []string
+	for _, a := range ev.DNS.Answers {
+		if a.Rdata == "" {
+			continue
+		}
+		answers = append(answers, a.Rdata)
+		ttls = append(ttls, a.TTL.String())
+	}
+	return &DNSRecord{
+		ts:      float64(ts.UnixNano()) / 1e9,
+		query:   ev.DNS.Rrname,
+		qtype:   ev.DNS.Rrtype,
+		answers: answers,
+		ttls:    ttls,
+	}, nil
+}
+
+func (s *SuricataEveRecordSource) Close() error {
+	return s.f.Close()
+}
+
+// DnstapRecordSource decodes a dnstap framestream, read from a plain file
+// or (when fn is "unix:<path>") a bidirectional unix socket, and emits
+// one DNSRecord per response_message, with every answer resource record
+// in it batched into that record's answers/ttls.
+type DnstapRecordSource struct {
+	f       io.ReadCloser
+	dec     *framestream.Decoder
+	pending []*DNSRecord
+}
+
+func NewDnstapRecordSource(fn string) (RecordSource, error) {
+	var f io.ReadCloser
+	bidirectional := strings.HasPrefix(fn, "unix:")
+	if bidirectional {
+		conn, err := net.Dial("unix", strings.TrimPrefix(fn, "unix:"))
+		if err != nil {
+			return nil, err
+		}
+		f = conn
+	} else {
+		opened, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		f = opened
+	}
+
+	dec, err := framestream.NewDecoder(f, &framestream.DecoderOptions{
+		ContentType:   []byte("protobuf:dnstap.Dnstap"),
+		Bidirectional: bidirectional,
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &DnstapRecordSource{f: f, dec: dec}, nil
+}
+
+func (d *DnstapRecordSource) Next() (*DNSRecord, error) {
+	for len(d.pending) == 0 {
+		buf, err := d.dec.Decode()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var dt dnstap.Dnstap
+		if err := proto.Unmarshal(buf, &dt); err != nil {
+			return nil, ErrSkipRecord
+		}
+		msg := dt.Message
+		if msg == nil || msg.ResponseMessage == nil {
+			continue
+		}
+
+		m := new(dns.Msg)
+		if err := m.Unpack(msg.ResponseMessage); err != nil {
+			return nil, ErrSkipRecord
+		}
+		ts := float64(msg.GetResponseTimeSec()) + float64(msg.GetResponseTimeNsec())/1e9
+		rec := dnstapRecordFromMessage(m, ts)
+		if rec == nil {
+			continue
+		}
+		d.pending = append(d.pending, rec)
+	}
+
+	rec := d.pending[0]
+	d.pending = d.pending[1:]
+	return rec, nil
+}
+
+// dnstapRecordFromMessage maps one unpacked dns.Msg response onto a
+// single DNSRecord with every answer RR batched into it, matching the
+// shape Zeek/Suricata sources produce and that AddRecord expects: it
+// counts the query once per call, so one call per answer RR would
+// inflate counts by the number of answers in the response. Returns nil
+// for a response with no question or no answers, which isn't malformed,
+// just not interesting.
+func dnstapRecordFromMessage(m *dns.Msg, ts float64) *DNSRecord {
+	if len(m.Question) == 0 || len(m.Answer) == 0 {
+		return nil
+	}
+
+	// Trim the trailing root dot miekg/dns always includes so the same
+	// domain queried via Zeek/Suricata/dnstap lands in the same
+	// tuples/individual, not disjoint ones.
+	query := strings.TrimSuffix(m.Question[0].Name, ".")
+	qtype := dns.TypeToString[m.Question[0].Qtype]
+
+	answers := make([]string, len(m.Answer))
+	ttls := make([]string, len(m.Answer))
+	for i, rr := range m.Answer {
+		answers[i] = dnstapAnswerData(rr)
+		ttls[i] = strconv.Itoa(int(rr.Header().Ttl))
+	}
+	return &DNSRecord{
+		ts:      ts,
+		query:   query,
+		qtype:   qtype,
+		answers: answers,
+		ttls:    ttls,
+	}
+}
+
+// dnstapAnswerData extracts the answer value aggregate() expects out of
+// an RR: the address for A/AAAA, the target for CNAME, and otherwise the
+// last whitespace-separated field of the RR's text form.
+func dnstapAnswerData(rr dns.RR) string {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.String()
+	case *dns.AAAA:
+		return v.AAAA.String()
+	case *dns.CNAME:
+		return strings.TrimSuffix(v.Target, ".")
+	default:
+		fields := strings.Fields(rr.String())
+		return fields[len(fields)-1]
+	}
+}
+
+func (d *DnstapRecordSource) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// Zeek's field mapping in ZeekRecordSource.Next is a thin pass-through
+// over BroReader (not part of this source tree), so it has nothing to
+// exercise independently of a live BroReader; parseSuricataEveLine and
+// dnstapRecordFromMessage below hold all of the per-format logic that
+// doesn't depend on a missing core type, including the bug this request
+// fixed.
+
+func TestParseSuricataEveLine(t *testing.T) {
+	cases := []struct {
+		name    string
+		line    string
+		want    *DNSRecord
+		wantErr error // non-nil means "must equal this error"
+		wantNil bool  // true means (nil, nil): not a dns event, skip quietly
+	}{
+		{
+			name: "normal dns event with one answer",
+			line: `{"event_type":"dns","timestamp":"2017-05-24T16:14:07.183971+0000","dns":{"rrname":"example.com","rrtype":"A","answers":[{"rdata":"93.184.216.34","ttl":300}]}}`,
+			want: &DNSRecord{
+				query:   "example.com",
+				qtype:   "A",
+				answers: []string{"93.184.216.34"},
+				ttls:    []string{"300"},
+			},
+		},
+		{
+			name: "multiple answers all batched into one record",
+			line: `{"event_type":"dns","timestamp":"2017-05-24T16:14:07.183971+0000","dns":{"rrname":"example.com","rrtype":"A","answers":[{"rdata":"1.2.3.4","ttl":60},{"rdata":"1.2.3.5","ttl":120}]}}`,
+			want: &DNSRecord{
+				query:   "example.com",
+				qtype:   "A",
+				answers: []string{"1.2.3.4", "1.2.3.5"},
+				ttls:    []string{"60", "120"},
+			},
+		},
+		{
+			name:    "non-dns event is skipped quietly",
+			line:    `{"event_type":"http","timestamp":"2017-05-24T16:14:07.183971+0000"}`,
+			wantNil: true,
+		},
+		{
+			name:    "dns event with empty rrname is skipped quietly",
+			line:    `{"event_type":"dns","timestamp":"2017-05-24T16:14:07.183971+0000","dns":{"rrname":""}}`,
+			wantNil: true,
+		},
+		{
+			name:    "unparsable json is ErrSkipRecord",
+			line:    `not json`,
+			wantErr: ErrSkipRecord,
+		},
+		{
+			name:    "timestamp without Suricata's colonless offset is ErrSkipRecord",
+			line:    `{"event_type":"dns","timestamp":"2017-05-24T16:14:07.183971+00:00","dns":{"rrname":"example.com","rrtype":"A"}}`,
+			wantErr: ErrSkipRecord,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec, err := parseSuricataEveLine([]byte(c.line))
+			if c.wantErr != nil {
+				if err != c.wantErr {
+					t.Fatalf("err = %v, want %v", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.wantNil {
+				if rec != nil {
+					t.Fatalf("rec = %+v, want nil", rec)
+				}
+				return
+			}
+			if rec.query != c.want.query || rec.qtype != c.want.qtype {
+				t.Fatalf("query/qtype = %q/%q, want %q/%q", rec.query, rec.qtype, c.want.query, c.want.qtype)
+			}
+			if len(rec.answers) != len(c.want.answers) {
+				t.Fatalf("answers = %v, want %v", rec.answers, c.want.answers)
+			}
+			for i := range rec.answers {
+				if rec.answers[i] != c.want.answers[i] || rec.ttls[i] != c.want.ttls[i] {
+					t.Errorf("answer[%d] = %s/%s, want %s/%s", i, rec.answers[i], rec.ttls[i], c.want.answers[i], c.want.ttls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDnstapRecordFromMessage(t *testing.T) {
+	newMsg := func(question string, answers ...dns.RR) *dns.Msg {
+		m := new(dns.Msg)
+		m.Question = []dns.Question{{Name: question, Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+		m.Answer = answers
+		return m
+	}
+	aRecord := func(name string, ttl uint32, ip string) *dns.A {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Ttl: ttl},
+			A:   mustParseIP(t, ip),
+		}
+	}
+
+	t.Run("trims the trailing root dot from the query name", func(t *testing.T) {
+		m := newMsg("example.com.", aRecord("example.com.", 300, "93.184.216.34"))
+		rec := dnstapRecordFromMessage(m, 123.0)
+		if rec == nil {
+			t.Fatal("rec = nil, want non-nil")
+		}
+		if rec.query != "example.com" {
+			t.Errorf("query = %q, want %q", rec.query, "example.com")
+		}
+	})
+
+	t.Run("batches every answer RR into one record instead of one per RR", func(t *testing.T) {
+		m := newMsg("example.com.",
+			aRecord("example.com.", 60, "1.2.3.4"),
+			aRecord("example.com.", 120, "1.2.3.5"),
+			aRecord("example.com.", 180, "1.2.3.6"),
+		)
+		rec := dnstapRecordFromMessage(m, 123.0)
+		if rec == nil {
+			t.Fatal("rec = nil, want non-nil")
+		}
+		if len(rec.answers) != 3 || len(rec.ttls) != 3 {
+			t.Fatalf("got %d answers / %d ttls, want 3/3 (one DNSRecord, not one per answer)", len(rec.answers), len(rec.ttls))
+		}
+		wantAnswers := []string{"1.2.3.4", "1.2.3.5", "1.2.3.6"}
+		wantTTLs := []string{"60", "120", "180"}
+		for i := range wantAnswers {
+			if rec.answers[i] != wantAnswers[i] || rec.ttls[i] != wantTTLs[i] {
+				t.Errorf("answer[%d] = %s/%s, want %s/%s", i, rec.answers[i], rec.ttls[i], wantAnswers[i], wantTTLs[i])
+			}
+		}
+	})
+
+	t.Run("no question or no answers yields nil, not an error", func(t *testing.T) {
+		noAnswers := newMsg("example.com.")
+		if rec := dnstapRecordFromMessage(noAnswers, 123.0); rec != nil {
+			t.Errorf("rec = %+v, want nil for a response with no answers", rec)
+		}
+
+		noQuestion := &dns.Msg{Answer: []dns.RR{aRecord("example.com.", 300, "1.2.3.4")}}
+		if rec := dnstapRecordFromMessage(noQuestion, 123.0); rec != nil {
+			t.Errorf("rec = %+v, want nil for a response with no question", rec)
+		}
+	})
+}
+
+func mustParseIP(t *testing.T, s string) net.IP {
+	t.Helper()
+	ip := net.ParseIP(s)
+	if ip == nil {
+		t.Fatalf("invalid test IP %q", s)
+	}
+	return ip
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// expireChunkSize bounds how many rows a single DELETE in Expire() removes,
+// so a large backlog doesn't hold a long lock against live Update() calls.
+var expireChunkSize = 10000
+
+// expirableTables allowlists the table names Expire will ever splice into
+// raw SQL. Policies are config-driven, so this is the only thing standing
+// between an operator's config file and an arbitrary string landing in a
+// DELETE statement.
+var expirableTables = map[string]bool{
+	"tuples":     true,
+	"individual": true,
+}
+
+// RetentionPolicy describes when rows in a table become eligible for
+// deletion. A row is removed once it is older than MaxAge (measured from
+// its last column); if MinCount is non-zero, that age threshold is
+// additionally narrowed to rows whose count is also below MinCount, so a
+// domain seen often enough is kept even past MaxAge.
+type RetentionPolicy struct {
+	Table    string        // "tuples" or "individual"
+	MaxAge   time.Duration // e.g. 180 * 24 * time.Hour for "last < now - 180d"
+	MinCount uint          // 0 disables the count threshold
+}
+
+// ExpireResult reports the outcome of a single Expire() call.
+type ExpireResult struct {
+	Removed  int64
+	Duration time.Duration
+}
+
+// Expirer is implemented by any Store that supports retention policies.
+type Expirer interface {
+	Expire(RetentionPolicy) (ExpireResult, error)
+}
+
+// Expire removes rows matching policy from the table it names, chunking
+// the delete into batches of expireChunkSize so it never holds a
+// long-running lock against concurrent Update() calls. A filenames row
+// is written recording how many rows were removed, so operators can
+// audit retention activity the same way they audit ingest runs.
+func (s *PGStore) Expire(policy RetentionPolicy) (ExpireResult, error) {
+	var result ExpireResult
+	if !expirableTables[policy.Table] {
+		return result, fmt.Errorf("retention: unknown table %q, must be one of tuples/individual", policy.Table)
+	}
+
+	start := time.Now()
+	cutoff := time.Now().Add(-policy.MaxAge)
+
+	where := "last < $1"
+	args := []interface{}{cutoff}
+	if policy.MinCount > 0 {
+		where = "last < $1 AND count < $2"
+		args = append(args, policy.MinCount)
+	}
+
+	deleteQuery := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE ctid IN (
+			SELECT ctid FROM %s WHERE %s LIMIT %d
+		)
+	`, policy.Table, policy.Table, where, expireChunkSize)
+
+	for {
+		res, err := s.conn.Exec(deleteQuery, args...)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.Removed += n
+		if n < int64(expireChunkSize) {
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+
+	_, err := s.conn.Exec(
+		"INSERT INTO filenames (filename, store_time, removed) VALUES ($1, $2, $3)",
+		fmt.Sprintf("expire:%s:%s", policy.Table, start.Format(time.RFC3339)),
+		result.Duration.Seconds(),
+		result.Removed,
+	)
+	return result, err
+}
+
+// runRetentionOnce runs every configured policy once against store. A
+// policy whose MaxAge fails to parse is logged and skipped rather than
+// aborting the rest; store not implementing Expirer is treated the same
+// way, since not every backend need support retention.
+func runRetentionOnce(store Store, policies []RetentionPolicyConfig) {
+	expirer, ok := store.(Expirer)
+	if !ok {
+		log.Printf("retention: store does not support Expire, skipping")
+		return
+	}
+	for _, p := range policies {
+		age, err := time.ParseDuration(p.MaxAge)
+		if err != nil {
+			log.Printf("retention: skipping policy for %q, bad max_age %q: %v", p.Table, p.MaxAge, err)
+			continue
+		}
+		result, err := expirer.Expire(RetentionPolicy{Table: p.Table, MaxAge: age, MinCount: p.MinCount})
+		if err != nil {
+			log.Printf("retention: %s: %v", p.Table, err)
+			continue
+		}
+		log.Printf("retention: %s: removed %d rows in %s", p.Table, result.Removed, result.Duration)
+	}
+}
+
+// RunRetentionLoop runs runRetentionOnce every interval until stop is
+// closed. This is the background goroutine a long-running process (the
+// stream subcommand, or retention run with -interval) starts so ingest
+// and expiry proceed side by side.
+func RunRetentionLoop(store Store, policies []RetentionPolicyConfig, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			runRetentionOnce(store, policies)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedAggregator fans DNSRecords across N independent DNSAggregator
+// shards, each owned by its own goroutine and fed by its own buffered
+// channel, so a single run can use multiple cores. Records for the same
+// query are always routed to the same shard, so per-query stats stay
+// correct without any locking inside AddRecord.
+type ShardedAggregator struct {
+	shards  []chan DNSRecord
+	aggs    []*DNSAggregator
+	wg      sync.WaitGroup
+	skipped int64 // atomic; see SkipRecord
+}
+
+// NewShardedAggregator starts workers goroutines, each consuming its own
+// shard. workers below 1 is treated as 1.
+func NewShardedAggregator(workers int) *ShardedAggregator {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &ShardedAggregator{
+		shards: make([]chan DNSRecord, workers),
+		aggs:   make([]*DNSAggregator, workers),
+	}
+	for i := range s.shards {
+		s.shards[i] = make(chan DNSRecord, 1024)
+		s.aggs[i] = NewDNSAggregator()
+		s.wg.Add(1)
+		go s.runShard(i)
+	}
+	return s
+}
+
+func (s *ShardedAggregator) runShard(i int) {
+	defer s.wg.Done()
+	agg := s.aggs[i]
+	for rec := range s.shards[i] {
+		agg.AddRecord(rec)
+	}
+}
+
+func shardFor(query string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(query))
+	return int(h.Sum32() % uint32(n))
+}
+
+// AddRecord routes rec to the shard owning its query. The caller is the
+// producer; this may be called concurrently from multiple producer
+// goroutines, e.g. one per input file.
+func (s *ShardedAggregator) AddRecord(rec DNSRecord) {
+	i := shardFor(rec.query, len(s.shards))
+	s.shards[i] <- rec
+}
+
+// SkipRecord counts a malformed record. It may be called concurrently by
+// any number of producer goroutines (e.g. one per input file), and those
+// calls race with shard 0's own consumer goroutine mutating its
+// DNSAggregator's skippedRecords via AddRecord's insane-length path, so
+// this uses its own atomic counter rather than writing through to a
+// shard's unsynchronized DNSAggregator field.
+func (s *ShardedAggregator) SkipRecord() {
+	atomic.AddInt64(&s.skipped, 1)
+}
+
+// Close stops accepting records and blocks until every shard has drained
+// its channel. AddRecord/SkipRecord must not be called after Close.
+func (s *ShardedAggregator) Close() {
+	for _, ch := range s.shards {
+		close(ch)
+	}
+	s.wg.Wait()
+}
+
+// Merge folds every shard into a single DNSAggregator using the existing
+// DNSAggregator.Merge, which already handles first/last/count correctly.
+// Close must be called first so every shard has stopped mutating state.
+func (s *ShardedAggregator) Merge() *DNSAggregator {
+	merged := NewDNSAggregator()
+	for _, agg := range s.aggs {
+		merged.Merge(agg)
+		merged.totalRecords += agg.totalRecords
+		merged.skippedRecords += agg.skippedRecords
+	}
+	merged.skippedRecords += uint(atomic.LoadInt64(&s.skipped))
+	return merged
+}
+
+// AggregateFilesSharded reads every file in fns concurrently, each
+// through its own RecordSource (format auto-detected per filename when
+// format is ""), routing every record into one ShardedAggregator shared
+// across all of them, and returns the merged result once every file and
+// every shard has finished. workers is exposed on the aggregate
+// subcommand as --workers.
+func AggregateFilesSharded(fns []string, format string, workers int) (*DNSAggregator, error) {
+	sharded := NewShardedAggregator(workers)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(fns))
+	for _, fn := range fns {
+		wg.Add(1)
+		go func(fn string) {
+			defer wg.Done()
+			if err := aggregateSharded(sharded, fn, format); err != nil {
+				errs <- err
+			}
+		}(fn)
+	}
+	wg.Wait()
+	sharded.Close()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sharded.Merge(), nil
+}
+
+func aggregateSharded(sharded *ShardedAggregator, fn string, format string) error {
+	src, err := NewRecordSource(fn, format)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	for {
+		rec, err := src.Next()
+		if err == ErrSkipRecord {
+			sharded.SkipRecord()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			break
+		}
+		sharded.AddRecord(*rec)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// syntheticRecords builds n DNSRecords over a fixed 5000-query universe,
+// which is enough for the shard hash to spread load evenly without
+// letting the benchmark's own allocation dominate the timed loop.
+func syntheticRecords(n int) []DNSRecord {
+	recs := make([]DNSRecord, n)
+	for i := range recs {
+		recs[i] = DNSRecord{
+			ts:      float64(i),
+			query:   fmt.Sprintf("host%d.example.com", i%5000),
+			qtype:   "A",
+			answers: []string{fmt.Sprintf("10.0.%d.%d", (i/256)%256, i%256)},
+			ttls:    []string{"300"},
+		}
+	}
+	return recs
+}
+
+func BenchmarkAggregateSingleThreaded(b *testing.B) {
+	recs := syntheticRecords(200000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		agg := NewDNSAggregator()
+		for _, r := range recs {
+			agg.AddRecord(r)
+		}
+	}
+}
+
+func benchmarkAggregateSharded(b *testing.B, workers int) {
+	recs := syntheticRecords(200000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sharded := NewShardedAggregator(workers)
+		for _, r := range recs {
+			sharded.AddRecord(r)
+		}
+		sharded.Close()
+		sharded.Merge()
+	}
+}
+
+func BenchmarkAggregateSharded2(b *testing.B) { benchmarkAggregateSharded(b, 2) }
+func BenchmarkAggregateSharded4(b *testing.B) { benchmarkAggregateSharded(b, 4) }
+func BenchmarkAggregateSharded8(b *testing.B) { benchmarkAggregateSharded(b, 8) }
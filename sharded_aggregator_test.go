@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestShardedAggregatorMatchesSingleThreaded is the actual correctness
+// check for sharding: the same records, split across several shards and
+// merged back together, must produce identical per-query counts and
+// first/last timestamps to running them through one DNSAggregator.
+// Sharding only changes how work is distributed, never what it computes.
+func TestShardedAggregatorMatchesSingleThreaded(t *testing.T) {
+	recs := syntheticRecords(20000)
+
+	want := NewDNSAggregator()
+	for _, r := range recs {
+		want.AddRecord(r)
+	}
+	wantResult := want.GetResult()
+
+	sharded := NewShardedAggregator(4)
+	for _, r := range recs {
+		sharded.AddRecord(r)
+	}
+	sharded.Close()
+	gotResult := sharded.Merge().GetResult()
+
+	if gotResult.TotalRecords != wantResult.TotalRecords {
+		t.Fatalf("TotalRecords = %d, want %d", gotResult.TotalRecords, wantResult.TotalRecords)
+	}
+	if gotResult.SkippedRecords != wantResult.SkippedRecords {
+		t.Fatalf("SkippedRecords = %d, want %d", gotResult.SkippedRecords, wantResult.SkippedRecords)
+	}
+
+	wantTuples := make(map[uniqueTuple]queryStat, len(wantResult.Tuples))
+	for _, tup := range wantResult.Tuples {
+		wantTuples[tup.uniqueTuple] = tup.queryStat
+	}
+	if len(gotResult.Tuples) != len(wantTuples) {
+		t.Fatalf("got %d tuples, want %d", len(gotResult.Tuples), len(wantTuples))
+	}
+	for _, tup := range gotResult.Tuples {
+		wantStat, ok := wantTuples[tup.uniqueTuple]
+		if !ok {
+			t.Fatalf("sharded produced unexpected tuple %+v", tup.uniqueTuple)
+		}
+		if tup.queryStat != wantStat {
+			t.Errorf("tuple %+v = %+v, want %+v", tup.uniqueTuple, tup.queryStat, wantStat)
+		}
+	}
+
+	wantIndividual := make(map[uniqueIndividual]queryStat, len(wantResult.Individual))
+	for _, ind := range wantResult.Individual {
+		wantIndividual[ind.uniqueIndividual] = ind.queryStat
+	}
+	if len(gotResult.Individual) != len(wantIndividual) {
+		t.Fatalf("got %d individuals, want %d", len(gotResult.Individual), len(wantIndividual))
+	}
+	for _, ind := range gotResult.Individual {
+		wantStat, ok := wantIndividual[ind.uniqueIndividual]
+		if !ok {
+			t.Fatalf("sharded produced unexpected individual %+v", ind.uniqueIndividual)
+		}
+		if ind.queryStat != wantStat {
+			t.Errorf("individual %+v = %+v, want %+v", ind.uniqueIndividual, ind.queryStat, wantStat)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMySQLExpireQuery(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("rejects a table not in expirableTables", func(t *testing.T) {
+		_, _, err := mysqlExpireQuery(RetentionPolicy{Table: "users"}, now, 10000)
+		if err == nil {
+			t.Fatal("err = nil, want an error for an unallowlisted table")
+		}
+	})
+
+	t.Run("MinCount 0 omits the count clause", func(t *testing.T) {
+		query, args, err := mysqlExpireQuery(RetentionPolicy{Table: "tuples", MaxAge: time.Hour}, now, 10000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(query, "count") {
+			t.Errorf("query = %q, want no count clause when MinCount is 0", query)
+		}
+		if len(args) != 1 {
+			t.Fatalf("args = %v, want exactly the cutoff", args)
+		}
+		if cutoff, ok := args[0].(time.Time); !ok || !cutoff.Equal(now.Add(-time.Hour)) {
+			t.Errorf("args[0] = %v, want cutoff %v", args[0], now.Add(-time.Hour))
+		}
+	})
+
+	t.Run("MinCount > 0 adds the count clause and argument", func(t *testing.T) {
+		query, args, err := mysqlExpireQuery(RetentionPolicy{Table: "individual", MaxAge: time.Hour, MinCount: 5}, now, 10000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "count < ?") {
+			t.Errorf("query = %q, want a count clause when MinCount > 0", query)
+		}
+		if len(args) != 2 || args[1] != uint(5) {
+			t.Fatalf("args = %v, want [cutoff, 5]", args)
+		}
+	})
+
+	t.Run("chunkSize bounds the LIMIT", func(t *testing.T) {
+		query, _, err := mysqlExpireQuery(RetentionPolicy{Table: "tuples", MaxAge: time.Hour}, now, 250)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasSuffix(query, "LIMIT 250") {
+			t.Errorf("query = %q, want it to end with LIMIT 250", query)
+		}
+	})
+}
+
+func TestSQLiteExpireQuery(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("rejects a table not in expirableTables", func(t *testing.T) {
+		_, _, err := sqliteExpireQuery(RetentionPolicy{Table: "users"}, now, 10000)
+		if err == nil {
+			t.Fatal("err = nil, want an error for an unallowlisted table")
+		}
+	})
+
+	t.Run("cutoff is epoch seconds, not a time.Time", func(t *testing.T) {
+		_, args, err := sqliteExpireQuery(RetentionPolicy{Table: "tuples", MaxAge: time.Hour}, now, 10000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := float64(now.Add(-time.Hour).Unix())
+		if got, ok := args[0].(float64); !ok || got != want {
+			t.Errorf("args[0] = %v, want epoch seconds %v", args[0], want)
+		}
+	})
+
+	t.Run("MinCount > 0 adds the count clause and argument", func(t *testing.T) {
+		query, args, err := sqliteExpireQuery(RetentionPolicy{Table: "individual", MaxAge: time.Hour, MinCount: 5}, now, 10000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "count < ?") {
+			t.Errorf("query = %q, want a count clause when MinCount > 0", query)
+		}
+		if len(args) != 2 || args[1] != uint(5) {
+			t.Fatalf("args = %v, want [cutoff, 5]", args)
+		}
+	})
+
+	t.Run("deletes through a rowid subquery, not a direct LIMIT", func(t *testing.T) {
+		query, _, err := sqliteExpireQuery(RetentionPolicy{Table: "tuples", MaxAge: time.Hour}, now, 10000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "rowid IN") {
+			t.Errorf("query = %q, want a rowid subquery (SQLite DELETE has no bare LIMIT)", query)
+		}
+	})
+}
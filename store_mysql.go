@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const mysqlSchema = `
+CREATE TABLE IF NOT EXISTS tuples (
+	query VARCHAR(512),
+	type VARCHAR(16),
+	answer VARCHAR(512),
+	count BIGINT,
+	ttl INT,
+	first DATETIME,
+	last DATETIME,
+	PRIMARY KEY (query, type, answer)
+);
+CREATE TABLE IF NOT EXISTS individual (
+	which CHAR(1),
+	value VARCHAR(512),
+	count BIGINT,
+	first DATETIME,
+	last DATETIME,
+	PRIMARY KEY (which, value)
+);
+CREATE TABLE IF NOT EXISTS filenames (
+	filename VARCHAR(512) PRIMARY KEY,
+	time DATETIME DEFAULT CURRENT_TIMESTAMP,
+	aggregation_time FLOAT,
+	total_records INT,
+	skipped_records INT,
+	tuples INT,
+	individual INT,
+	store_time FLOAT,
+	inserted INT,
+	updated INT,
+	removed INT
+);
+`
+
+type MySQLStore struct {
+	conn *sqlx.DB
+	*SQLCommonStore
+
+	// Subscribers, when set, is fanned out newly inserted tuples and
+	// individuals once Update's transaction has committed.
+	Subscribers *SubscriberHub
+}
+
+func NewMySQLStore(uri string) (Store, error) {
+	conn, err := sqlx.Open("mysql", uri)
+	if err != nil {
+		return nil, err
+	}
+	common := &SQLCommonStore{conn: conn}
+	return &MySQLStore{conn: conn, SQLCommonStore: common}, nil
+}
+
+func (s *MySQLStore) Close() error {
+	return s.conn.Close()
+}
+
+func (s *MySQLStore) SetSubscribers(h *SubscriberHub) { s.Subscribers = h }
+
+func (s *MySQLStore) Init() error {
+	_, err := s.conn.Exec(mysqlSchema)
+	return err
+}
+
+// Update folds ar into tuples/individual using MySQL's native
+// INSERT ... ON DUPLICATE KEY UPDATE upsert, one row at a time: MySQL has
+// no COPY-style bulk load path, so unlike PGStore.updateBulk this stays
+// row-at-a-time, same as PGStore's legacy path. With CLIENT_FOUND_ROWS
+// unset (the driver default), RowsAffected reports 1 for an insert and 2
+// for a row that was actually changed, which is how Inserted/Updated are
+// told apart.
+func (s *MySQLStore) Update(ar aggregationResult) (UpdateResult, error) {
+	var result UpdateResult
+	start := time.Now()
+
+	tx, err := s.BeginTx()
+	if err != nil {
+		return result, err
+	}
+
+	var newTuples []JSONTuple
+	var newIndividual []JSONIndividual
+
+	tupleStmt, err := tx.Prepare(`
+		INSERT INTO tuples (query, type, answer, count, ttl, first, last)
+		VALUES (?, ?, ?, ?, ?, FROM_UNIXTIME(?), FROM_UNIXTIME(?))
+		ON DUPLICATE KEY UPDATE
+			count = count + VALUES(count),
+			ttl = VALUES(ttl),
+			first = LEAST(first, VALUES(first)),
+			last = GREATEST(last, VALUES(last))
+	`)
+	if err != nil {
+		return result, err
+	}
+	defer tupleStmt.Close()
+
+	for _, q := range ar.Tuples {
+		query := Reverse(q.query)
+		res, err := tupleStmt.Exec(query, q.qtype, q.answer, q.count, q.ttl, q.first, q.last)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		if n == 1 {
+			result.Inserted++
+			newTuples = append(newTuples, JSONTuple{
+				Query: Reverse(query), Type: q.qtype, Answer: q.answer, TTL: q.ttl,
+				Count: q.count, First: uint64(q.first), Last: uint64(q.last),
+			})
+		} else {
+			result.Updated++
+		}
+	}
+
+	individualStmt, err := tx.Prepare(`
+		INSERT INTO individual (which, value, count, first, last)
+		VALUES (?, ?, ?, FROM_UNIXTIME(?), FROM_UNIXTIME(?))
+		ON DUPLICATE KEY UPDATE
+			count = count + VALUES(count),
+			first = LEAST(first, VALUES(first)),
+			last = GREATEST(last, VALUES(last))
+	`)
+	if err != nil {
+		return result, err
+	}
+	defer individualStmt.Close()
+
+	for _, q := range ar.Individual {
+		value := q.value
+		if q.which == "Q" {
+			value = Reverse(value)
+		}
+		res, err := individualStmt.Exec(q.which, value, q.count, q.first, q.last)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		if n == 1 {
+			result.Inserted++
+			newIndividual = append(newIndividual, JSONIndividual{
+				Value: q.value, Which: q.which, Count: q.count, First: uint64(q.first), Last: uint64(q.last),
+			})
+		} else {
+			result.Updated++
+		}
+	}
+
+	result.Duration = time.Since(start)
+	if err := s.Commit(); err != nil {
+		return result, err
+	}
+
+	if s.Subscribers != nil {
+		for _, t := range newTuples {
+			s.Subscribers.PublishTuple(t)
+		}
+		for _, i := range newIndividual {
+			s.Subscribers.PublishIndividual(i)
+		}
+	}
+	return result, nil
+}
+
+// mysqlExpireQuery builds the chunked DELETE Expire issues for policy,
+// rejecting any table not in expirableTables before it ever reaches SQL.
+func mysqlExpireQuery(policy RetentionPolicy, now time.Time, chunkSize int) (string, []interface{}, error) {
+	if !expirableTables[policy.Table] {
+		return "", nil, fmt.Errorf("retention: unknown table %q, must be one of tuples/individual", policy.Table)
+	}
+
+	cutoff := now.Add(-policy.MaxAge)
+	where := "last < ?"
+	args := []interface{}{cutoff}
+	if policy.MinCount > 0 {
+		where = "last < ? AND count < ?"
+		args = append(args, policy.MinCount)
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT %d", policy.Table, where, chunkSize), args, nil
+}
+
+// Expire removes rows matching policy the same way PGStore.Expire does:
+// chunked deletes so a large backlog never holds one long lock, and a
+// filenames row recording how many were removed. MySQL supports LIMIT
+// directly on a single-table DELETE, so this needs no ctid-style subquery.
+func (s *MySQLStore) Expire(policy RetentionPolicy) (ExpireResult, error) {
+	var result ExpireResult
+	start := time.Now()
+
+	deleteQuery, args, err := mysqlExpireQuery(policy, start, expireChunkSize)
+	if err != nil {
+		return result, err
+	}
+
+	for {
+		res, err := s.conn.Exec(deleteQuery, args...)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.Removed += n
+		if n < int64(expireChunkSize) {
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+	_, err = s.conn.Exec(
+		"INSERT INTO filenames (filename, store_time, removed) VALUES (?, ?, ?)",
+		fmt.Sprintf("expire:%s:%s", policy.Table, start.Format(time.RFC3339)),
+		result.Duration.Seconds(),
+		result.Removed,
+	)
+	return result, err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -51,8 +52,15 @@ CREATE TABLE IF NOT EXISTS filenames (
 	individual int,
 	store_time real,
 	inserted int,
-	updated int
+	updated int,
+	removed int
 );
+`
+
+// pgLegacyUpsertSchema holds the row-at-a-time PL/pgSQL upsert helpers used
+// by the pre-9.5 compatible path. It is only applied when PGStore.LegacyUpsert
+// is set, since PG >= 9.5 can do the same work with INSERT ... ON CONFLICT.
+const pgLegacyUpsertSchema = `
 CREATE OR REPLACE FUNCTION update_individual(w char(1), v text, c integer,f timestamp,l timestamp) RETURNS CHAR(1) AS
 $$
 BEGIN
@@ -108,26 +116,68 @@ $$
 LANGUAGE plpgsql;
 `
 
+// pgStagingSchema backs the COPY + INSERT ... ON CONFLICT bulk upsert path.
+// The staging tables are UNLOGGED and truncated at the start of every
+// Update(), so they never need to survive a crash.
+const pgStagingSchema = `
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_tuples (
+	query text,
+	type text,
+	answer text,
+	count bigint,
+	ttl text,
+	first double precision,
+	last double precision
+);
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_individual (
+	which char(1),
+	value text,
+	count bigint,
+	first double precision,
+	last double precision
+);
+`
+
 type PGStore struct {
 	conn *sqlx.DB
 	*SQLCommonStore
+
+	// LegacyUpsert selects the row-at-a-time update_tuples/update_individual
+	// PL/pgSQL path instead of the COPY + INSERT ... ON CONFLICT bulk path.
+	// Only needed against PostgreSQL servers older than 9.5, which lack
+	// ON CONFLICT support; set via the db_legacy_upsert config field.
+	LegacyUpsert bool
+
+	// Subscribers, when set, is fanned out the inserted (not updated)
+	// tuples and individuals the bulk upsert path in updateBulk found,
+	// once its transaction has committed. The legacy path publishes
+	// nothing. Left nil, Update behaves exactly as before.
+	Subscribers *SubscriberHub
 }
 
-func NewPGStore(uri string) (Store, error) {
+func NewPGStore(uri string, legacyUpsert bool) (Store, error) {
 	conn, err := sqlx.Open("postgres", uri)
 	if err != nil {
 		return nil, err
 	}
 	common := &SQLCommonStore{conn: conn}
-	return &PGStore{conn: conn, SQLCommonStore: common}, nil
+	return &PGStore{conn: conn, SQLCommonStore: common, LegacyUpsert: legacyUpsert}, nil
 }
 
 func (s *PGStore) Close() error {
-	return s.Close()
+	return s.conn.Close()
 }
 
+func (s *PGStore) SetSubscribers(h *SubscriberHub) { s.Subscribers = h }
+
 func (s *PGStore) Init() error {
-	_, err := s.conn.Exec(pgschema)
+	schema := pgschema
+	if s.LegacyUpsert {
+		schema += pgLegacyUpsertSchema
+	} else {
+		schema += pgStagingSchema
+	}
+	_, err := s.conn.Exec(schema)
 	// Ignore a duplicte table error message
 	if pqerr, ok := err.(*pq.Error); ok {
 		if pqerr.Code == "42P07" {
@@ -157,6 +207,186 @@ func genFullBatchSelect(tmpl string, batchSize int) string {
 var BATCHSIZE = 200
 
 func (s *PGStore) Update(ar aggregationResult) (UpdateResult, error) {
+	if s.LegacyUpsert {
+		return s.updateLegacy(ar)
+	}
+	return s.updateBulk(ar)
+}
+
+// updateBulk streams the aggregation result into UNLOGGED staging tables
+// via COPY FROM STDIN and folds it into tuples/individual with a single
+// INSERT ... ON CONFLICT per table. This replaces the row-at-a-time
+// update_tuples/update_individual calls, which dominate store time on
+// large dns.log files.
+func (s *PGStore) updateBulk(ar aggregationResult) (UpdateResult, error) {
+	var result UpdateResult
+	start := time.Now()
+
+	tx, err := s.BeginTx()
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := tx.Exec("TRUNCATE staging_tuples, staging_individual"); err != nil {
+		return result, err
+	}
+
+	tupleCopy, err := tx.Prepare(pq.CopyIn("staging_tuples", "query", "type", "answer", "count", "ttl", "first", "last"))
+	if err != nil {
+		return result, err
+	}
+	for _, q := range ar.Tuples {
+		query := Reverse(q.query)
+		if _, err := tupleCopy.Exec(query, q.qtype, q.answer, q.count, q.ttl, q.first, q.last); err != nil {
+			return result, err
+		}
+	}
+	if _, err := tupleCopy.Exec(); err != nil {
+		return result, err
+	}
+	if err := tupleCopy.Close(); err != nil {
+		return result, err
+	}
+
+	individualCopy, err := tx.Prepare(pq.CopyIn("staging_individual", "which", "value", "count", "first", "last"))
+	if err != nil {
+		return result, err
+	}
+	for _, q := range ar.Individual {
+		value := q.value
+		if q.which == "Q" {
+			value = Reverse(value)
+		}
+		if _, err := individualCopy.Exec(q.which, value, q.count, q.first, q.last); err != nil {
+			return result, err
+		}
+	}
+	if _, err := individualCopy.Exec(); err != nil {
+		return result, err
+	}
+	if err := individualCopy.Close(); err != nil {
+		return result, err
+	}
+
+	upsertTuples := `
+		INSERT INTO tuples (query, type, answer, count, ttl, first, last)
+		SELECT query, type, answer, sum(count), max(ttl)::integer,
+			to_timestamp(min(first))::timestamp, to_timestamp(max(last))::timestamp
+		FROM staging_tuples
+		GROUP BY query, type, answer
+		ON CONFLICT (query, type, answer) DO UPDATE
+		SET count = tuples.count + EXCLUDED.count,
+		    ttl = EXCLUDED.ttl,
+		    first = LEAST(tuples.first, EXCLUDED.first),
+		    last = GREATEST(tuples.last, EXCLUDED.last)
+		RETURNING (xmax = 0), query, type, answer, count, ttl, first, last
+	`
+	var newTuples []JSONTuple
+	var newIndividual []JSONIndividual
+
+	tupleRows, err := tx.Query(upsertTuples)
+	if err != nil {
+		return result, err
+	}
+	for tupleRows.Next() {
+		var inserted bool
+		var query, qtype, answer string
+		var count int64
+		var ttl sql.NullInt64
+		var first, last time.Time
+		if err := tupleRows.Scan(&inserted, &query, &qtype, &answer, &count, &ttl, &first, &last); err != nil {
+			tupleRows.Close()
+			return result, err
+		}
+		if !inserted {
+			result.Updated++
+			continue
+		}
+		result.Inserted++
+		newTuples = append(newTuples, JSONTuple{
+			Query:  Reverse(query),
+			Type:   qtype,
+			Answer: answer,
+			TTL:    strconv.FormatInt(ttl.Int64, 10),
+			Count:  uint(count),
+			First:  uint64(first.Unix()),
+			Last:   uint64(last.Unix()),
+		})
+	}
+	if err := tupleRows.Err(); err != nil {
+		tupleRows.Close()
+		return result, err
+	}
+	tupleRows.Close()
+
+	upsertIndividual := `
+		INSERT INTO individual (which, value, count, first, last)
+		SELECT which, value, sum(count),
+			to_timestamp(min(first))::timestamp, to_timestamp(max(last))::timestamp
+		FROM staging_individual
+		GROUP BY which, value
+		ON CONFLICT (which, value) DO UPDATE
+		SET count = individual.count + EXCLUDED.count,
+		    first = LEAST(individual.first, EXCLUDED.first),
+		    last = GREATEST(individual.last, EXCLUDED.last)
+		RETURNING (xmax = 0), which, value, count, first, last
+	`
+	individualRows, err := tx.Query(upsertIndividual)
+	if err != nil {
+		return result, err
+	}
+	for individualRows.Next() {
+		var inserted bool
+		var which, value string
+		var count int64
+		var first, last time.Time
+		if err := individualRows.Scan(&inserted, &which, &value, &count, &first, &last); err != nil {
+			individualRows.Close()
+			return result, err
+		}
+		if !inserted {
+			result.Updated++
+			continue
+		}
+		result.Inserted++
+		if which == "Q" {
+			value = Reverse(value)
+		}
+		newIndividual = append(newIndividual, JSONIndividual{
+			Value: value,
+			Which: which,
+			Count: uint(count),
+			First: uint64(first.Unix()),
+			Last:  uint64(last.Unix()),
+		})
+	}
+	if err := individualRows.Err(); err != nil {
+		individualRows.Close()
+		return result, err
+	}
+	individualRows.Close()
+
+	result.Duration = time.Since(start)
+	if err := s.Commit(); err != nil {
+		return result, err
+	}
+
+	// Only announce "newly observed" tuples/individuals once the
+	// transaction that persisted them has actually committed, so a
+	// commit failure can never produce a false-positive first-seen
+	// notification to Subscribers.
+	if s.Subscribers != nil {
+		for _, t := range newTuples {
+			s.Subscribers.PublishTuple(t)
+		}
+		for _, i := range newIndividual {
+			s.Subscribers.PublishIndividual(i)
+		}
+	}
+	return result, nil
+}
+
+func (s *PGStore) updateLegacy(ar aggregationResult) (UpdateResult, error) {
 	var result UpdateResult
 	start := time.Now()
 
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tuples (
+	query TEXT,
+	type TEXT,
+	answer TEXT,
+	count INTEGER,
+	ttl INTEGER,
+	first REAL,
+	last REAL,
+	PRIMARY KEY (query, type, answer)
+);
+CREATE INDEX IF NOT EXISTS tuples_query ON tuples(query);
+CREATE INDEX IF NOT EXISTS tuples_answer ON tuples(answer);
+
+CREATE TABLE IF NOT EXISTS individual (
+	which TEXT,
+	value TEXT,
+	count INTEGER,
+	first REAL,
+	last REAL,
+	PRIMARY KEY (which, value)
+);
+CREATE INDEX IF NOT EXISTS individual_value ON individual(value);
+
+CREATE TABLE IF NOT EXISTS filenames (
+	filename TEXT PRIMARY KEY,
+	time REAL DEFAULT (strftime('%s','now')),
+	aggregation_time REAL,
+	total_records INTEGER,
+	skipped_records INTEGER,
+	tuples INTEGER,
+	individual INTEGER,
+	store_time REAL,
+	inserted INTEGER,
+	updated INTEGER,
+	removed INTEGER
+);
+`
+
+// SQLiteStore stores first/last as raw epoch-seconds REAL columns rather
+// than a timestamp type, since SQLite has no native datetime storage.
+type SQLiteStore struct {
+	conn *sqlx.DB
+	*SQLCommonStore
+
+	// Subscribers, when set, is fanned out newly inserted tuples and
+	// individuals once Update's transaction has committed.
+	Subscribers *SubscriberHub
+}
+
+func NewSQLiteStore(path string) (Store, error) {
+	conn, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	common := &SQLCommonStore{conn: conn}
+	return &SQLiteStore{conn: conn, SQLCommonStore: common}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.conn.Close()
+}
+
+func (s *SQLiteStore) SetSubscribers(h *SubscriberHub) { s.Subscribers = h }
+
+func (s *SQLiteStore) Init() error {
+	_, err := s.conn.Exec(sqliteSchema)
+	return err
+}
+
+// Update folds ar into tuples/individual one row at a time, like
+// update_tuples/update_individual in the Postgres legacy path, but in the
+// opposite order: it tries the INSERT first and falls back to an UPDATE
+// (those functions try the UPDATE first). SQLite's single-statement upsert can't report
+// whether it inserted or updated a row, so INSERT OR IGNORE's
+// RowsAffected tells them apart instead.
+func (s *SQLiteStore) Update(ar aggregationResult) (UpdateResult, error) {
+	var result UpdateResult
+	start := time.Now()
+
+	tx, err := s.BeginTx()
+	if err != nil {
+		return result, err
+	}
+
+	var newTuples []JSONTuple
+	var newIndividual []JSONIndividual
+
+	insertTuple, err := tx.Prepare(`INSERT OR IGNORE INTO tuples (query, type, answer, count, ttl, first, last) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return result, err
+	}
+	defer insertTuple.Close()
+
+	updateTuple, err := tx.Prepare(`
+		UPDATE tuples SET count = count + ?, ttl = ?, first = MIN(first, ?), last = MAX(last, ?)
+		WHERE query = ? AND type = ? AND answer = ?
+	`)
+	if err != nil {
+		return result, err
+	}
+	defer updateTuple.Close()
+
+	for _, q := range ar.Tuples {
+		query := Reverse(q.query)
+		res, err := insertTuple.Exec(query, q.qtype, q.answer, q.count, q.ttl, q.first, q.last)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		if n == 1 {
+			result.Inserted++
+			newTuples = append(newTuples, JSONTuple{
+				Query: q.query, Type: q.qtype, Answer: q.answer, TTL: q.ttl,
+				Count: q.count, First: uint64(q.first), Last: uint64(q.last),
+			})
+			continue
+		}
+		if _, err := updateTuple.Exec(q.count, q.ttl, q.first, q.last, query, q.qtype, q.answer); err != nil {
+			return result, err
+		}
+		result.Updated++
+	}
+
+	insertIndividual, err := tx.Prepare(`INSERT OR IGNORE INTO individual (which, value, count, first, last) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return result, err
+	}
+	defer insertIndividual.Close()
+
+	updateIndividual, err := tx.Prepare(`
+		UPDATE individual SET count = count + ?, first = MIN(first, ?), last = MAX(last, ?)
+		WHERE which = ? AND value = ?
+	`)
+	if err != nil {
+		return result, err
+	}
+	defer updateIndividual.Close()
+
+	for _, q := range ar.Individual {
+		value := q.value
+		if q.which == "Q" {
+			value = Reverse(value)
+		}
+		res, err := insertIndividual.Exec(q.which, value, q.count, q.first, q.last)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		if n == 1 {
+			result.Inserted++
+			newIndividual = append(newIndividual, JSONIndividual{
+				Value: q.value, Which: q.which, Count: q.count, First: uint64(q.first), Last: uint64(q.last),
+			})
+			continue
+		}
+		if _, err := updateIndividual.Exec(q.count, q.first, q.last, q.which, value); err != nil {
+			return result, err
+		}
+		result.Updated++
+	}
+
+	result.Duration = time.Since(start)
+	if err := s.Commit(); err != nil {
+		return result, err
+	}
+
+	if s.Subscribers != nil {
+		for _, t := range newTuples {
+			s.Subscribers.PublishTuple(t)
+		}
+		for _, i := range newIndividual {
+			s.Subscribers.PublishIndividual(i)
+		}
+	}
+	return result, nil
+}
+
+// sqliteExpireQuery builds the chunked DELETE Expire issues for policy,
+// rejecting any table not in expirableTables before it ever reaches SQL.
+// cutoff is epoch seconds since that's how SQLiteStore stores first/last.
+func sqliteExpireQuery(policy RetentionPolicy, now time.Time, chunkSize int) (string, []interface{}, error) {
+	if !expirableTables[policy.Table] {
+		return "", nil, fmt.Errorf("retention: unknown table %q, must be one of tuples/individual", policy.Table)
+	}
+
+	cutoff := float64(now.Add(-policy.MaxAge).Unix())
+	where := "last < ?"
+	args := []interface{}{cutoff}
+	if policy.MinCount > 0 {
+		where = "last < ? AND count < ?"
+		args = append(args, policy.MinCount)
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE rowid IN (
+			SELECT rowid FROM %s WHERE %s LIMIT %d
+		)
+	`, policy.Table, policy.Table, where, chunkSize)
+	return query, args, nil
+}
+
+// Expire removes rows matching policy the same way PGStore.Expire does.
+// SQLite's DELETE has no LIMIT clause without a non-default compile
+// flag, so chunking uses the same rowid-subquery trick PGStore uses with
+// ctid.
+func (s *SQLiteStore) Expire(policy RetentionPolicy) (ExpireResult, error) {
+	var result ExpireResult
+	start := time.Now()
+
+	deleteQuery, args, err := sqliteExpireQuery(policy, start, expireChunkSize)
+	if err != nil {
+		return result, err
+	}
+
+	for {
+		res, err := s.conn.Exec(deleteQuery, args...)
+		if err != nil {
+			return result, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.Removed += n
+		if n < int64(expireChunkSize) {
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+	_, err = s.conn.Exec(
+		"INSERT INTO filenames (filename, store_time, removed) VALUES (?, ?, ?)",
+		fmt.Sprintf("expire:%s:%s", policy.Table, start.Format(time.RFC3339)),
+		result.Duration.Seconds(),
+		result.Removed,
+	)
+	return result, err
+}
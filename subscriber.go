@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Subscriber receives rows a Store's Update inserted rather than updated:
+// in PGStore's bulk path, those whose RETURNING (xmax = 0) is true; in
+// MySQLStore and SQLiteStore, those whose insert affected exactly one row. This
+// turns bro-pdns into a real-time first-seen-domain feed for downstream
+// threat-intel tooling.
+type Subscriber interface {
+	OnNewTuple(JSONTuple)
+	OnNewIndividual(JSONIndividual)
+	Flush() error
+}
+
+type subscriberEvent struct {
+	tuple      *JSONTuple
+	individual *JSONIndividual
+}
+
+// SubscriberSetter is implemented by every Store backend that fans newly
+// inserted rows out to a SubscriberHub, letting callers wire one up
+// without a type switch over the concrete Store.
+type SubscriberSetter interface {
+	SetSubscribers(*SubscriberHub)
+}
+
+// subscriberHubBufferSize bounds how many undelivered events SubscriberHub
+// will buffer before it starts dropping; see SubscriberHub's doc comment.
+const subscriberHubBufferSize = 1024
+
+// buildSubscribers constructs one Subscriber per entry in cfgs, in order,
+// failing on the first one that can't be built (e.g. a Kafka producer
+// that can't reach its brokers).
+func buildSubscribers(cfgs []SubscriberConfig) ([]Subscriber, error) {
+	subs := make([]Subscriber, 0, len(cfgs))
+	for _, c := range cfgs {
+		switch c.Kind {
+		case "webhook":
+			batchSize := c.BatchSize
+			if batchSize <= 0 {
+				batchSize = 1
+			}
+			subs = append(subs, NewWebhookSubscriber(c.URL, batchSize))
+		case "kafka":
+			k, err := NewKafkaSubscriber(c.Brokers, c.Topic)
+			if err != nil {
+				return nil, fmt.Errorf("subscriber: kafka %q: %w", c.Topic, err)
+			}
+			subs = append(subs, k)
+		case "file":
+			f, err := NewFileSubscriber(c.Path)
+			if err != nil {
+				return nil, fmt.Errorf("subscriber: file %q: %w", c.Path, err)
+			}
+			subs = append(subs, f)
+		default:
+			return nil, fmt.Errorf("subscriber: unknown kind %q", c.Kind)
+		}
+	}
+	return subs, nil
+}
+
+// SubscriberHub fans newly inserted tuples/individuals out to registered
+// Subscribers over a bounded channel, so the upsert transaction that
+// discovered them is never blocked by a slow or stuck subscriber. When
+// the buffer is full, events are dropped and logged rather than applying
+// backpressure to the DB transaction.
+type SubscriberHub struct {
+	subs   []Subscriber
+	events chan subscriberEvent
+	done   chan struct{}
+}
+
+// NewSubscriberHub starts a hub delivering to subs, buffering up to
+// bufferSize events before it starts dropping.
+func NewSubscriberHub(bufferSize int, subs ...Subscriber) *SubscriberHub {
+	h := &SubscriberHub{
+		subs:   subs,
+		events: make(chan subscriberEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *SubscriberHub) run() {
+	defer close(h.done)
+	for ev := range h.events {
+		for _, s := range h.subs {
+			if ev.tuple != nil {
+				s.OnNewTuple(*ev.tuple)
+			} else {
+				s.OnNewIndividual(*ev.individual)
+			}
+		}
+	}
+}
+
+// PublishTuple offers a newly inserted tuple to subscribers without
+// blocking the caller.
+func (h *SubscriberHub) PublishTuple(t JSONTuple) {
+	select {
+	case h.events <- subscriberEvent{tuple: &t}:
+	default:
+		log.Printf("subscriber: dropping new tuple %s/%s/%s, subscribers are falling behind", t.Query, t.Type, t.Answer)
+	}
+}
+
+// PublishIndividual offers a newly inserted individual to subscribers
+// without blocking the caller.
+func (h *SubscriberHub) PublishIndividual(i JSONIndividual) {
+	select {
+	case h.events <- subscriberEvent{individual: &i}:
+	default:
+		log.Printf("subscriber: dropping new individual %s, subscribers are falling behind", i.Value)
+	}
+}
+
+// Close stops delivering events and flushes every registered Subscriber.
+func (h *SubscriberHub) Close() error {
+	close(h.events)
+	<-h.done
+	var firstErr error
+	for _, s := range h.subs {
+		if err := s.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WebhookSubscriber batches events as NDJSON and POSTs them to URL,
+// retrying with exponential backoff on failure or a 5xx response.
+type WebhookSubscriber struct {
+	URL       string
+	BatchSize int
+	Client    *http.Client
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	pending int
+}
+
+func NewWebhookSubscriber(url string, batchSize int) *WebhookSubscriber {
+	return &WebhookSubscriber{URL: url, BatchSize: batchSize, Client: http.DefaultClient}
+}
+
+func (w *WebhookSubscriber) OnNewTuple(t JSONTuple)           { w.append(t) }
+func (w *WebhookSubscriber) OnNewIndividual(i JSONIndividual) { w.append(i) }
+
+func (w *WebhookSubscriber) append(v interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := json.NewEncoder(&w.buf).Encode(v); err != nil {
+		log.Printf("subscriber: failed to encode event for %s: %v", w.URL, err)
+		return
+	}
+	w.pending++
+	if w.pending >= w.BatchSize {
+		w.postLocked()
+	}
+}
+
+func (w *WebhookSubscriber) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.postLocked()
+}
+
+func (w *WebhookSubscriber) postLocked() error {
+	if w.pending == 0 {
+		return nil
+	}
+	body := append([]byte(nil), w.buf.Bytes()...)
+	n := w.pending
+	w.buf.Reset()
+	w.pending = 0
+
+	var err error
+	backoff := 500 * time.Millisecond
+	for attempt := 1; attempt <= 5; attempt++ {
+		var resp *http.Response
+		resp, err = w.Client.Post(w.URL, "application/x-ndjson", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				return nil
+			}
+			err = fmt.Errorf("subscriber: webhook %s returned %s", w.URL, resp.Status)
+		}
+		log.Printf("subscriber: webhook post of %d events failed (attempt %d/5): %v", n, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// KafkaSubscriber publishes each event as a JSON message to a Kafka topic.
+type KafkaSubscriber struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewKafkaSubscriber(brokers []string, topic string) (*KafkaSubscriber, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	cfg.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSubscriber{producer: producer, topic: topic}, nil
+}
+
+func (k *KafkaSubscriber) OnNewTuple(t JSONTuple)           { k.send(t) }
+func (k *KafkaSubscriber) OnNewIndividual(i JSONIndividual) { k.send(i) }
+
+func (k *KafkaSubscriber) send(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("subscriber: failed to marshal kafka event: %v", err)
+		return
+	}
+	if _, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: k.topic,
+		Value: sarama.ByteEncoder(b),
+	}); err != nil {
+		log.Printf("subscriber: kafka publish to %s failed: %v", k.topic, err)
+	}
+}
+
+func (k *KafkaSubscriber) Flush() error {
+	return nil
+}
+
+// FileSubscriber appends each event as a line of NDJSON to a local file.
+type FileSubscriber struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileSubscriber(path string) (*FileSubscriber, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSubscriber{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (fs *FileSubscriber) OnNewTuple(t JSONTuple)           { fs.write(t) }
+func (fs *FileSubscriber) OnNewIndividual(i JSONIndividual) { fs.write(i) }
+
+func (fs *FileSubscriber) write(v interface{}) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.enc.Encode(v); err != nil {
+		log.Printf("subscriber: failed to write event to %s: %v", fs.f.Name(), err)
+	}
+}
+
+func (fs *FileSubscriber) Flush() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.f.Sync()
+}